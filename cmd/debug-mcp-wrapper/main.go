@@ -7,6 +7,7 @@ import (
 	"os/signal"
 	"syscall"
 
+	"github.com/wachterjohannes/debug-mcp-go-wrapper/internal/admin"
 	"github.com/wachterjohannes/debug-mcp-go-wrapper/internal/config"
 	"github.com/wachterjohannes/debug-mcp-go-wrapper/internal/proxy"
 )
@@ -27,6 +28,14 @@ func main() {
 	log.Printf("PHP binary: %s", cfg.PHPBinary)
 	log.Printf("Restart interval: %s", cfg.RestartInterval)
 	log.Printf("Buffer size: %d messages", cfg.BufferSize)
+	log.Printf("Replay stale after: %s", cfg.ReplayStaleAfter)
+	log.Printf("Workers: %d", cfg.Workers)
+	log.Printf("Stderr format: %s", cfg.StderrFormat)
+	log.Printf("Crash loop breaker: %d failures within %s", cfg.CrashLoopMaxFailures, cfg.CrashLoopWindow)
+	log.Printf("Drain timeout: %s", cfg.DrainTimeout)
+	if cfg.AdminAddr != "" {
+		log.Printf("Admin addr: %s", cfg.AdminAddr)
+	}
 
 	// Create context with signal handling
 	ctx, stop := signal.NotifyContext(
@@ -42,8 +51,26 @@ func main() {
 		cfg.PHPBinary,
 		cfg.RestartInterval,
 		cfg.BufferSize,
+		cfg.Workers,
+		cfg.ReplayStaleAfter,
+		cfg.StderrFormat,
+		cfg.CrashLoopMaxFailures,
+		cfg.CrashLoopWindow,
+		cfg.DrainTimeout,
+		cfg.DebugTailSize,
+		cfg.RedactTail,
 	)
 
+	// Start the admin server, if configured
+	if cfg.AdminAddr != "" {
+		adminServer := admin.NewServer(cfg.AdminAddr, p)
+		go func() {
+			if err := adminServer.ListenAndServe(); err != nil {
+				log.Printf("Admin server error: %v", err)
+			}
+		}()
+	}
+
 	// Run proxy
 	if err := p.Run(ctx); err != nil {
 		log.Fatalf("Proxy error: %v", err)
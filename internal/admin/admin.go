@@ -0,0 +1,66 @@
+// Package admin exposes an HTTP server for observing a running proxy:
+// liveness, Prometheus metrics, and a tail of recently proxied messages.
+package admin
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/wachterjohannes/debug-mcp-go-wrapper/internal/proxy"
+)
+
+// Server serves /healthz, /metrics, and /debug/tail for a *proxy.Proxy.
+type Server struct {
+	addr string
+	p    *proxy.Proxy
+}
+
+// NewServer creates an admin server for p, listening on addr.
+func NewServer(addr string, p *proxy.Proxy) *Server {
+	return &Server{addr: addr, p: p}
+}
+
+// ListenAndServe starts the admin HTTP server. It blocks until the server
+// stops, the same as http.Server.ListenAndServe.
+func (s *Server) ListenAndServe() error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", s.handleHealthz)
+	mux.HandleFunc("/metrics", s.handleMetrics)
+	mux.HandleFunc("/debug/tail", s.handleDebugTail)
+
+	log.Printf("Admin server listening on %s", s.addr)
+	return http.ListenAndServe(s.addr, mux)
+}
+
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	if !s.p.Healthy() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintln(w, "unhealthy")
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	s.p.WriteMetrics(w)
+}
+
+func (s *Server) handleDebugTail(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain")
+
+	in, out := s.p.TailSnapshot()
+	fmt.Fprintln(w, "# in")
+	writeTail(w, in)
+	fmt.Fprintln(w, "# out")
+	writeTail(w, out)
+}
+
+func writeTail(w io.Writer, entries []proxy.TailEntry) {
+	for _, e := range entries {
+		fmt.Fprintf(w, "%s %s\n", e.Timestamp.Format(time.RFC3339Nano), e.Data)
+	}
+}
@@ -3,16 +3,28 @@ package config
 import (
 	"errors"
 	"flag"
+	"fmt"
 	"os"
 	"time"
+
+	"github.com/wachterjohannes/debug-mcp-go-wrapper/internal/stderrlog"
 )
 
 // Config holds the application configuration
 type Config struct {
-	WorkingDir      string
-	PHPBinary       string
-	RestartInterval time.Duration
-	BufferSize      int
+	WorkingDir           string
+	PHPBinary            string
+	RestartInterval      time.Duration
+	BufferSize           int
+	ReplayStaleAfter     time.Duration
+	Workers              int
+	StderrFormat         stderrlog.Format
+	CrashLoopMaxFailures int
+	CrashLoopWindow      time.Duration
+	DrainTimeout         time.Duration
+	AdminAddr            string
+	DebugTailSize        int
+	RedactTail           bool
 }
 
 // LoadConfig loads configuration from command-line flags and environment variables
@@ -23,10 +35,27 @@ func LoadConfig() (*Config, error) {
 		BufferSize:      100,
 	}
 
+	var stderrFormat string
+
 	// Parse command-line flags
 	flag.StringVar(&cfg.WorkingDir, "cwd", "", "Working directory (where debug-mcp is installed)")
+	flag.DurationVar(&cfg.ReplayStaleAfter, "replay-stale-after", 30*time.Second, "Drop and fail outstanding requests older than this instead of replaying them after a restart")
+	flag.IntVar(&cfg.Workers, "workers", 1, "Number of PHP worker processes in the pool")
+	flag.StringVar(&stderrFormat, "stderr-format", string(stderrlog.FormatAuto), "How to interpret PHP stderr lines: json, raw, or auto")
+	flag.IntVar(&cfg.CrashLoopMaxFailures, "crash-loop-max-failures", 5, "Give up restarting a worker after this many failures within --crash-loop-window")
+	flag.DurationVar(&cfg.CrashLoopWindow, "crash-loop-window", 60*time.Second, "Rolling window over which crash-loop failures are counted")
+	flag.DurationVar(&cfg.DrainTimeout, "drain-timeout", 5*time.Second, "How long to wait for in-flight requests to complete before terminating a worker for a scheduled restart")
+	flag.StringVar(&cfg.AdminAddr, "admin-addr", "", "If set, address for the admin HTTP server (/healthz, /metrics, /debug/tail)")
+	flag.IntVar(&cfg.DebugTailSize, "debug-tail-size", 50, "Number of recent messages per direction kept for /debug/tail")
+	flag.BoolVar(&cfg.RedactTail, "redact-tail", false, "Redact message bodies in /debug/tail, keeping only their length")
 	flag.Parse()
 
+	format, err := stderrlog.ParseFormat(stderrFormat)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --stderr-format: %w", err)
+	}
+	cfg.StderrFormat = format
+
 	// Fall back to environment variable if flag not set
 	if cfg.WorkingDir == "" {
 		cfg.WorkingDir = os.Getenv("DEBUG_MCP_DIR")
@@ -42,6 +71,14 @@ func LoadConfig() (*Config, error) {
 		return nil, errors.New("working directory does not exist: " + cfg.WorkingDir)
 	}
 
+	if cfg.Workers < 1 {
+		return nil, errors.New("workers must be at least 1")
+	}
+
+	if cfg.CrashLoopMaxFailures < 1 {
+		return nil, errors.New("crash-loop-max-failures must be at least 1")
+	}
+
 	return cfg, nil
 }
 
@@ -0,0 +1,68 @@
+package proxy
+
+import (
+	"math/rand"
+	"time"
+)
+
+const (
+	// backoffBase is the delay before the first restart attempt after a crash.
+	backoffBase = 250 * time.Millisecond
+	// backoffMax caps how long monitorWorker will wait between attempts.
+	backoffMax = 30 * time.Second
+	// healthyAfter is how long a worker must stay up before a subsequent
+	// crash is treated as a fresh failure rather than part of the same loop.
+	healthyAfter = 30 * time.Second
+)
+
+// crashLoopBreaker tracks a worker's restart failures and decides when to
+// back off before retrying, and when to give up entirely.
+type crashLoopBreaker struct {
+	maxFailures int
+	window      time.Duration
+
+	failureTimes []time.Time
+	backoffStep  uint
+}
+
+// newCrashLoopBreaker creates a breaker that trips once maxFailures restarts
+// have happened within window.
+func newCrashLoopBreaker(maxFailures int, window time.Duration) *crashLoopBreaker {
+	return &crashLoopBreaker{maxFailures: maxFailures, window: window}
+}
+
+// recordHealthy resets the backoff and failure history, called once a
+// process has stayed alive past healthyAfter.
+func (c *crashLoopBreaker) recordHealthy() {
+	c.backoffStep = 0
+	c.failureTimes = nil
+}
+
+// recordFailure records a crash at the given time and reports whether the
+// circuit should trip, i.e. too many failures happened within window.
+func (c *crashLoopBreaker) recordFailure(at time.Time) bool {
+	cutoff := at.Add(-c.window)
+	kept := c.failureTimes[:0]
+	for _, t := range c.failureTimes {
+		if t.After(cutoff) {
+			kept = append(kept, t)
+		}
+	}
+	c.failureTimes = append(kept, at)
+	return len(c.failureTimes) >= c.maxFailures
+}
+
+// nextBackoff returns the delay to wait before the next restart attempt. The
+// step doubles from backoffBase up to backoffMax, and the returned delay is
+// a random value between half the step and the full step, so that a pool of
+// workers crashing together doesn't retry in lockstep.
+func (c *crashLoopBreaker) nextBackoff() time.Duration {
+	delay := backoffBase << c.backoffStep
+	if delay <= 0 || delay > backoffMax {
+		delay = backoffMax
+	}
+	c.backoffStep++
+
+	jitter := time.Duration(rand.Int63n(int64(delay)/2 + 1))
+	return delay/2 + jitter
+}
@@ -0,0 +1,42 @@
+package proxy
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCrashLoopBreakerTripsAfterMaxFailures(t *testing.T) {
+	c := newCrashLoopBreaker(3, time.Minute)
+	now := time.Now()
+
+	if c.recordFailure(now) {
+		t.Fatal("should not trip on the 1st failure")
+	}
+	if c.recordFailure(now) {
+		t.Fatal("should not trip on the 2nd failure")
+	}
+	if !c.recordFailure(now) {
+		t.Fatal("should trip on the 3rd failure within the window")
+	}
+}
+
+func TestCrashLoopBreakerForgetsFailuresOutsideWindow(t *testing.T) {
+	c := newCrashLoopBreaker(2, time.Minute)
+	start := time.Now()
+
+	c.recordFailure(start)
+	if c.recordFailure(start.Add(2 * time.Minute)) {
+		t.Fatal("a failure outside the window should not count toward older ones")
+	}
+}
+
+func TestCrashLoopBreakerRecordHealthyResetsState(t *testing.T) {
+	c := newCrashLoopBreaker(2, time.Minute)
+	now := time.Now()
+
+	c.recordFailure(now)
+	c.recordHealthy()
+	if c.recordFailure(now) {
+		t.Fatal("should not trip right after recordHealthy reset the failure history")
+	}
+}
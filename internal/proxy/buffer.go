@@ -1,69 +1,123 @@
 package proxy
 
 import (
-	"io"
+	"encoding/json"
 	"sync"
+	"time"
 )
 
-// MessageBuffer provides thread-safe circular buffering for MCP messages
+// pendingRequest is a single outbound request that has not yet received a
+// matching response on stdout.
+type pendingRequest struct {
+	id       json.RawMessage
+	raw      []byte
+	queuedAt time.Time
+}
+
+// MessageBuffer tracks in-flight JSON-RPC requests by id so that, across a
+// PHP restart, only requests still awaiting a response are replayed.
+// Notifications are never tracked since they have no id to correlate a
+// response against.
 type MessageBuffer struct {
-	mu       sync.Mutex
-	messages [][]byte
-	maxSize  int
+	mu         sync.Mutex
+	pending    map[string]*pendingRequest
+	order      []string
+	maxSize    int
+	staleAfter time.Duration
 }
 
-// NewMessageBuffer creates a new message buffer with the specified maximum size
-func NewMessageBuffer(size int) *MessageBuffer {
+// NewMessageBuffer creates a buffer that tracks at most size outstanding
+// requests, replaying any still-outstanding request younger than staleAfter.
+func NewMessageBuffer(size int, staleAfter time.Duration) *MessageBuffer {
 	return &MessageBuffer{
-		messages: make([][]byte, 0, size),
-		maxSize:  size,
+		pending:    make(map[string]*pendingRequest, size),
+		maxSize:    size,
+		staleAfter: staleAfter,
 	}
 }
 
-// Add appends a message to the buffer
-// If the buffer is full, the oldest message is removed (circular buffer behavior)
-func (b *MessageBuffer) Add(message []byte) {
+// Track records msg as outstanding. Notifications are ignored since they
+// never receive a response to correlate. If the buffer is already at
+// capacity, the oldest outstanding request is evicted and returned so the
+// caller can synthesize an error response for it instead of leaving its
+// client hanging forever.
+func (b *MessageBuffer) Track(msg *rpcMessage) (evicted *pendingRequest) {
+	if msg.isNotification() {
+		return nil
+	}
+
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	if len(b.messages) >= b.maxSize {
-		// Remove oldest message (circular buffer)
-		b.messages = b.messages[1:]
+	key := msg.idKey()
+	if _, exists := b.pending[key]; !exists {
+		if len(b.order) >= b.maxSize {
+			oldest := b.order[0]
+			b.order = b.order[1:]
+			evicted = b.pending[oldest]
+			delete(b.pending, oldest)
+		}
+		b.order = append(b.order, key)
 	}
-
-	// Make a copy of the message to avoid issues with slice reuse
-	msgCopy := make([]byte, len(message))
-	copy(msgCopy, message)
-	b.messages = append(b.messages, msgCopy)
+	b.pending[key] = &pendingRequest{
+		id:       msg.id,
+		raw:      msg.raw,
+		queuedAt: time.Now(),
+	}
+	return evicted
 }
 
-// Replay writes all buffered messages to the provided writer
-// After replaying, the buffer is cleared
-func (b *MessageBuffer) Replay(writer io.Writer) error {
+// Resolve removes id from the outstanding set because a response for it has
+// been observed on stdout, returning the time it was tracked so the caller
+// can measure round-trip latency. ok is false if id wasn't outstanding.
+func (b *MessageBuffer) Resolve(id json.RawMessage) (queuedAt time.Time, ok bool) {
+	if id == nil {
+		return time.Time{}, false
+	}
+
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	for _, msg := range b.messages {
-		if _, err := writer.Write(msg); err != nil {
-			return err
+	key := string(id)
+	req, exists := b.pending[key]
+	if !exists {
+		return time.Time{}, false
+	}
+	delete(b.pending, key)
+	for i, k := range b.order {
+		if k == key {
+			b.order = append(b.order[:i], b.order[i+1:]...)
+			break
 		}
 	}
-
-	// Clear the buffer after successful replay
-	b.messages = b.messages[:0]
-	return nil
+	return req.queuedAt, true
 }
 
-// Len returns the current number of messages in the buffer
-func (b *MessageBuffer) Len() int {
+// Drain removes all outstanding requests and splits them into those fresh
+// enough to replay against a new process and those stale enough that the
+// caller should synthesize an error response instead.
+func (b *MessageBuffer) Drain() (replay, stale []*pendingRequest) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
-	return len(b.messages)
+
+	now := time.Now()
+	for _, key := range b.order {
+		req := b.pending[key]
+		if now.Sub(req.queuedAt) > b.staleAfter {
+			stale = append(stale, req)
+		} else {
+			replay = append(replay, req)
+		}
+	}
+
+	b.pending = make(map[string]*pendingRequest, b.maxSize)
+	b.order = nil
+	return replay, stale
 }
 
-// Clear removes all messages from the buffer
-func (b *MessageBuffer) Clear() {
+// Len returns the current number of outstanding requests.
+func (b *MessageBuffer) Len() int {
 	b.mu.Lock()
 	defer b.mu.Unlock()
-	b.messages = b.messages[:0]
+	return len(b.order)
 }
@@ -0,0 +1,64 @@
+package proxy
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func trackedRequest(id string) *rpcMessage {
+	return &rpcMessage{raw: []byte(`{"id":` + id + `}` + "\n"), id: json.RawMessage(id)}
+}
+
+func TestMessageBufferResolve(t *testing.T) {
+	b := NewMessageBuffer(10, time.Minute)
+	b.Track(trackedRequest("1"))
+
+	if _, ok := b.Resolve(json.RawMessage("2")); ok {
+		t.Fatal("Resolve of untracked id should report ok=false")
+	}
+	if _, ok := b.Resolve(json.RawMessage("1")); !ok {
+		t.Fatal("Resolve of tracked id should report ok=true")
+	}
+	if b.Len() != 0 {
+		t.Fatalf("Len() = %d after resolving the only tracked request, want 0", b.Len())
+	}
+}
+
+func TestMessageBufferTrackEvictsOldestAtCapacity(t *testing.T) {
+	b := NewMessageBuffer(2, time.Minute)
+	b.Track(trackedRequest("1"))
+	b.Track(trackedRequest("2"))
+
+	evicted := b.Track(trackedRequest("3"))
+	if evicted == nil {
+		t.Fatal("expected the oldest request to be evicted once the buffer is full")
+	}
+	if string(evicted.id) != "1" {
+		t.Fatalf("evicted id = %q, want %q", evicted.id, "1")
+	}
+	if b.Len() != 2 {
+		t.Fatalf("Len() = %d, want 2", b.Len())
+	}
+	if _, ok := b.Resolve(json.RawMessage("1")); ok {
+		t.Fatal("evicted request should no longer be tracked")
+	}
+}
+
+func TestMessageBufferDrainSplitsStaleFromReplay(t *testing.T) {
+	b := NewMessageBuffer(10, 10*time.Millisecond)
+	b.Track(trackedRequest("1"))
+	time.Sleep(20 * time.Millisecond)
+	b.Track(trackedRequest("2"))
+
+	replay, stale := b.Drain()
+	if len(replay) != 1 || string(replay[0].id) != "2" {
+		t.Fatalf("replay = %v, want only id 2", replay)
+	}
+	if len(stale) != 1 || string(stale[0].id) != "1" {
+		t.Fatalf("stale = %v, want only id 1", stale)
+	}
+	if b.Len() != 0 {
+		t.Fatalf("Len() = %d after Drain, want 0", b.Len())
+	}
+}
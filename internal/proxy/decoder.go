@@ -0,0 +1,133 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// rpcMessage is a single decoded MCP message together with its framed bytes
+// (see decodeMessage), so it can be replayed or forwarded as a whole message.
+type rpcMessage struct {
+	raw []byte
+	id  json.RawMessage // nil for notifications
+}
+
+// isNotification reports whether the message has no "id" field and therefore
+// must not be replayed after a restart.
+func (m *rpcMessage) isNotification() bool {
+	return m.id == nil
+}
+
+// idKey returns a stable map key for the message's JSON-RPC id.
+func (m *rpcMessage) idKey() string {
+	return string(m.id)
+}
+
+// MessageDecoder reads whole MCP messages off a stream. MCP allows either
+// newline-delimited JSON-RPC or LSP-style "Content-Length" framing, so Next
+// detects which one is in use on a per-message basis.
+type MessageDecoder struct {
+	r *bufio.Reader
+}
+
+// NewMessageDecoder wraps r so whole MCP messages can be read with Next.
+func NewMessageDecoder(r io.Reader) *MessageDecoder {
+	return &MessageDecoder{r: bufio.NewReaderSize(r, 64*1024)}
+}
+
+// Next reads and returns the next whole MCP message, or an error (io.EOF on
+// clean close).
+func (d *MessageDecoder) Next() (*rpcMessage, error) {
+	for {
+		line, err := d.r.ReadBytes('\n')
+		if err != nil && len(line) == 0 {
+			return nil, err
+		}
+
+		trimmed := bytes.TrimSpace(line)
+		if len(trimmed) == 0 {
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if contentLength, ok := parseContentLength(trimmed); ok {
+			if err := d.skipRemainingHeaders(); err != nil {
+				return nil, err
+			}
+			body := make([]byte, contentLength)
+			if _, err := io.ReadFull(d.r, body); err != nil {
+				return nil, err
+			}
+			header := fmt.Sprintf("Content-Length: %d\r\n\r\n", contentLength)
+			framed := make([]byte, 0, len(header)+len(body))
+			framed = append(framed, header...)
+			framed = append(framed, body...)
+			return decodeMessage(framed, body), nil
+		}
+
+		framed := make([]byte, 0, len(trimmed)+1)
+		framed = append(framed, trimmed...)
+		framed = append(framed, '\n')
+		return decodeMessage(framed, trimmed), nil
+	}
+}
+
+// skipRemainingHeaders consumes LSP headers up to and including the blank
+// line that separates them from the message body.
+func (d *MessageDecoder) skipRemainingHeaders() error {
+	for {
+		line, err := d.r.ReadBytes('\n')
+		if err != nil {
+			return err
+		}
+		if len(bytes.TrimSpace(line)) == 0 {
+			return nil
+		}
+	}
+}
+
+// parseContentLength reports whether line is a "Content-Length: N" header and,
+// if so, returns the parsed length.
+func parseContentLength(line []byte) (int, bool) {
+	const prefix = "Content-Length:"
+	if !bytes.HasPrefix(line, []byte(prefix)) {
+		return 0, false
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(string(line[len(prefix):])))
+	if err != nil {
+		return 0, false
+	}
+	return n, true
+}
+
+// decodeMessage extracts the JSON-RPC id (if any) from body and returns an
+// rpcMessage whose raw bytes are framed in the style the message arrived in
+// (the trimmed line plus a trailing newline, or the body behind a rebuilt
+// "Content-Length" header; any other LSP headers are dropped), so it can be
+// forwarded or replayed without a peer hanging waiting for a missing delimiter.
+// Malformed JSON is treated as a notification-like message that carries no id.
+func decodeMessage(framed, body []byte) *rpcMessage {
+	var envelope struct {
+		ID json.RawMessage `json:"id"`
+	}
+	msg := &rpcMessage{raw: framed}
+	if err := json.Unmarshal(body, &envelope); err == nil && len(envelope.ID) > 0 && !bytes.Equal(envelope.ID, []byte("null")) {
+		msg.id = envelope.ID
+	}
+	return msg
+}
+
+// synthesizeRestartError builds a JSON-RPC error response for a request that
+// is abandoned instead of being answered by a worker: too stale to replay,
+// evicted from a full buffer, or not replayable because its worker could not
+// be restarted.
+func synthesizeRestartError(id json.RawMessage) []byte {
+	return []byte(fmt.Sprintf(`{"jsonrpc":"2.0","id":%s,"error":{"code":-32001,"message":"server restarted"}}`+"\n", id))
+}
@@ -0,0 +1,73 @@
+package proxy
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestMessageDecoderNewlineDelimitedRoundTrip(t *testing.T) {
+	input := `{"jsonrpc":"2.0","id":1,"method":"foo"}` + "\n" +
+		`{"jsonrpc":"2.0","id":2,"method":"bar"}` + "\n"
+	decoder := NewMessageDecoder(strings.NewReader(input))
+
+	first, err := decoder.Next()
+	if err != nil {
+		t.Fatalf("first Next: %v", err)
+	}
+	second, err := decoder.Next()
+	if err != nil {
+		t.Fatalf("second Next: %v", err)
+	}
+
+	// Forwarding both messages' raw bytes back-to-back must reproduce two
+	// distinct newline-delimited messages, not a concatenated blob.
+	var forwarded bytes.Buffer
+	forwarded.Write(first.raw)
+	forwarded.Write(second.raw)
+	if got := forwarded.String(); got != input {
+		t.Fatalf("forwarded bytes = %q, want %q", got, input)
+	}
+
+	if string(first.id) != "1" || string(second.id) != "2" {
+		t.Fatalf("got ids %q, %q, want 1, 2", first.id, second.id)
+	}
+}
+
+func TestMessageDecoderContentLengthRoundTrip(t *testing.T) {
+	body1 := `{"jsonrpc":"2.0","id":1,"method":"foo"}`
+	body2 := `{"jsonrpc":"2.0","id":2,"method":"bar"}`
+	input := "Content-Length: " + strconv.Itoa(len(body1)) + "\r\n\r\n" + body1 +
+		"Content-Length: " + strconv.Itoa(len(body2)) + "\r\n\r\n" + body2
+	decoder := NewMessageDecoder(strings.NewReader(input))
+
+	first, err := decoder.Next()
+	if err != nil {
+		t.Fatalf("first Next: %v", err)
+	}
+	second, err := decoder.Next()
+	if err != nil {
+		t.Fatalf("second Next: %v", err)
+	}
+
+	var forwarded bytes.Buffer
+	forwarded.Write(first.raw)
+	forwarded.Write(second.raw)
+	if got := forwarded.String(); got != input {
+		t.Fatalf("forwarded bytes = %q, want %q", got, input)
+	}
+}
+
+func TestMessageDecoderNotificationHasNoID(t *testing.T) {
+	input := `{"jsonrpc":"2.0","method":"notify"}` + "\n"
+	decoder := NewMessageDecoder(strings.NewReader(input))
+
+	msg, err := decoder.Next()
+	if err != nil {
+		t.Fatalf("Next: %v", err)
+	}
+	if !msg.isNotification() {
+		t.Fatal("expected a notification (no id)")
+	}
+}
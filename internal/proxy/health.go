@@ -0,0 +1,68 @@
+package proxy
+
+import (
+	"fmt"
+	"time"
+)
+
+// pingTimeout bounds how long Healthy waits for a worker to answer a ping
+// before considering it unresponsive.
+const pingTimeout = 2 * time.Second
+
+// Healthy reports whether at least one worker is alive and answers an MCP
+// ping promptly, for the admin server's /healthz endpoint.
+func (p *Proxy) Healthy() bool {
+	for _, w := range p.workers {
+		if w.restarting.Load() {
+			continue
+		}
+		if p.ping(w, pingTimeout) {
+			return true
+		}
+	}
+	return false
+}
+
+// ping sends a JSON-RPC ping to w and reports whether it answered within
+// timeout. The response is correlated by id the same way any other request's
+// response is, via proxyWorkerStdout.
+func (p *Proxy) ping(w *worker, timeout time.Duration) bool {
+	id := fmt.Sprintf("%q", fmt.Sprintf("admin-ping-%d", time.Now().UnixNano()))
+	waiter := make(chan struct{}, 1)
+
+	p.pingMu.Lock()
+	p.pingWaiters[id] = waiter
+	p.pingMu.Unlock()
+	defer func() {
+		p.pingMu.Lock()
+		delete(p.pingWaiters, id)
+		p.pingMu.Unlock()
+	}()
+
+	req := []byte(fmt.Sprintf(`{"jsonrpc":"2.0","id":%s,"method":"ping"}`+"\n", id))
+	if _, err := w.currentProcess().Stdin().Write(req); err != nil {
+		return false
+	}
+
+	select {
+	case <-waiter:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// notifyPingWaiter wakes up a pending ping call if idKey matches one.
+func (p *Proxy) notifyPingWaiter(idKey string) {
+	p.pingMu.Lock()
+	waiter, ok := p.pingWaiters[idKey]
+	p.pingMu.Unlock()
+
+	if !ok {
+		return
+	}
+	select {
+	case waiter <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,120 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// latencyBuckets are the histogram boundaries for request round-trip
+// latency, matching the spread of delays a restart or a slow PHP handler
+// would plausibly introduce.
+var latencyBuckets = []time.Duration{
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	5 * time.Second,
+}
+
+// metrics holds process-wide counters and a round-trip latency histogram,
+// written out in Prometheus text format by Proxy.WriteMetrics.
+type metrics struct {
+	messagesIn  atomic.Int64
+	messagesOut atomic.Int64
+	restarts    atomic.Int64
+	crashes     atomic.Int64
+	drops       atomic.Int64
+
+	latencyMu     sync.Mutex
+	latencyCounts []int64 // cumulative bucket counts, plus a trailing +Inf bucket
+	latencySum    time.Duration
+	latencyCount  int64
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		latencyCounts: make([]int64, len(latencyBuckets)+1),
+	}
+}
+
+// observeLatency records a single request's round-trip latency, measured
+// from when it was sent to a worker to when its response was seen.
+func (m *metrics) observeLatency(d time.Duration) {
+	m.latencyMu.Lock()
+	defer m.latencyMu.Unlock()
+
+	m.latencySum += d
+	m.latencyCount++
+	for i, bucket := range latencyBuckets {
+		if d <= bucket {
+			m.latencyCounts[i]++
+		}
+	}
+	m.latencyCounts[len(m.latencyCounts)-1]++ // +Inf
+}
+
+// writeLatencyHistogram renders the histogram in Prometheus text exposition format.
+func (m *metrics) writeLatencyHistogram(w io.Writer) {
+	m.latencyMu.Lock()
+	defer m.latencyMu.Unlock()
+
+	fmt.Fprintln(w, "# HELP debug_mcp_request_latency_seconds Round-trip latency between a request and its matching response.")
+	fmt.Fprintln(w, "# TYPE debug_mcp_request_latency_seconds histogram")
+	for i, bucket := range latencyBuckets {
+		fmt.Fprintf(w, "debug_mcp_request_latency_seconds_bucket{le=\"%s\"} %d\n", formatSeconds(bucket), m.latencyCounts[i])
+	}
+	fmt.Fprintf(w, "debug_mcp_request_latency_seconds_bucket{le=\"+Inf\"} %d\n", m.latencyCounts[len(m.latencyCounts)-1])
+	fmt.Fprintf(w, "debug_mcp_request_latency_seconds_sum %s\n", formatSeconds(m.latencySum))
+	fmt.Fprintf(w, "debug_mcp_request_latency_seconds_count %d\n", m.latencyCount)
+}
+
+func formatSeconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', -1, 64)
+}
+
+// WriteMetrics writes the proxy's current metrics in Prometheus text
+// exposition format, for the admin server's /metrics endpoint.
+func (p *Proxy) WriteMetrics(w io.Writer) {
+	fmt.Fprintln(w, "# HELP debug_mcp_messages_in_total Messages proxied from the client to a PHP worker.")
+	fmt.Fprintln(w, "# TYPE debug_mcp_messages_in_total counter")
+	fmt.Fprintf(w, "debug_mcp_messages_in_total %d\n", p.metrics.messagesIn.Load())
+
+	fmt.Fprintln(w, "# HELP debug_mcp_messages_out_total Messages proxied from a PHP worker to the client.")
+	fmt.Fprintln(w, "# TYPE debug_mcp_messages_out_total counter")
+	fmt.Fprintf(w, "debug_mcp_messages_out_total %d\n", p.metrics.messagesOut.Load())
+
+	fmt.Fprintln(w, "# HELP debug_mcp_restarts_total Scheduled and crash-induced worker restarts.")
+	fmt.Fprintln(w, "# TYPE debug_mcp_restarts_total counter")
+	fmt.Fprintf(w, "debug_mcp_restarts_total %d\n", p.metrics.restarts.Load())
+
+	fmt.Fprintln(w, "# HELP debug_mcp_crashes_total Unexpected PHP worker process exits.")
+	fmt.Fprintln(w, "# TYPE debug_mcp_crashes_total counter")
+	fmt.Fprintf(w, "debug_mcp_crashes_total %d\n", p.metrics.crashes.Load())
+
+	fmt.Fprintln(w, "# HELP debug_mcp_drops_total Requests answered with a synthesized restart error instead of a worker response (stale, evicted, or not replayable).")
+	fmt.Fprintln(w, "# TYPE debug_mcp_drops_total counter")
+	fmt.Fprintf(w, "debug_mcp_drops_total %d\n", p.metrics.drops.Load())
+
+	fmt.Fprintln(w, "# HELP debug_mcp_worker_buffer_occupancy Outstanding requests currently tracked per worker.")
+	fmt.Fprintln(w, "# TYPE debug_mcp_worker_buffer_occupancy gauge")
+	for _, wk := range p.workers {
+		fmt.Fprintf(w, "debug_mcp_worker_buffer_occupancy{worker=\"%d\"} %d\n", wk.index, wk.buffer.Len())
+	}
+
+	fmt.Fprintln(w, "# HELP debug_mcp_worker_restarting Whether a worker is currently draining for a restart.")
+	fmt.Fprintln(w, "# TYPE debug_mcp_worker_restarting gauge")
+	for _, wk := range p.workers {
+		v := 0
+		if wk.restarting.Load() {
+			v = 1
+		}
+		fmt.Fprintf(w, "debug_mcp_worker_restarting{worker=\"%d\"} %d\n", wk.index, v)
+	}
+
+	p.metrics.writeLatencyHistogram(w)
+}
@@ -4,9 +4,13 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"log/slog"
+	"os"
 	"os/exec"
 	"syscall"
 	"time"
+
+	"github.com/wachterjohannes/debug-mcp-go-wrapper/internal/stderrlog"
 )
 
 // PHPProcess manages the lifecycle of a PHP debug-mcp server process
@@ -15,11 +19,21 @@ type PHPProcess struct {
 	stdin  io.WriteCloser
 	stdout io.ReadCloser
 	stderr io.ReadCloser
+
+	stderrFormat stderrlog.Format
+	logSource    string
+	logger       *slog.Logger
 }
 
-// NewPHPProcess creates a new PHPProcess instance
-func NewPHPProcess() *PHPProcess {
-	return &PHPProcess{}
+// NewPHPProcess creates a new PHPProcess instance. source identifies this
+// process (e.g. a worker index) in its structured log output, and format
+// controls how its stderr is interpreted.
+func NewPHPProcess(format stderrlog.Format, source string) *PHPProcess {
+	return &PHPProcess{
+		stderrFormat: format,
+		logSource:    source,
+		logger:       slog.New(slog.NewTextHandler(os.Stderr, nil)),
+	}
 }
 
 // Start launches the PHP process with the specified working directory and PHP binary
@@ -55,7 +69,7 @@ func (p *PHPProcess) Start(workingDir, phpBinary string) error {
 	log.Printf("PHP process started (PID: %d)", p.cmd.Process.Pid)
 
 	// Start stderr logger
-	go p.logStderr()
+	go stderrlog.NewScanner(p.stderr, p.stderrFormat, p.logger, p.logSource).Run()
 
 	return nil
 }
@@ -118,20 +132,3 @@ func (p *PHPProcess) Wait() error {
 	}
 	return p.cmd.Wait()
 }
-
-// logStderr continuously reads and logs stderr from the PHP process
-func (p *PHPProcess) logStderr() {
-	buf := make([]byte, 4096)
-	for {
-		n, err := p.stderr.Read(buf)
-		if n > 0 {
-			log.Printf("[PHP stderr] %s", string(buf[:n]))
-		}
-		if err != nil {
-			if err != io.EOF {
-				log.Printf("Error reading PHP stderr: %v", err)
-			}
-			return
-		}
-	}
-}
@@ -1,202 +1,412 @@
 package proxy
 
 import (
-	"bufio"
 	"context"
 	"fmt"
+	"hash/fnv"
 	"io"
 	"log"
 	"os"
+	"sync"
 	"time"
+
+	"github.com/wachterjohannes/debug-mcp-go-wrapper/internal/stderrlog"
 )
 
-// Proxy coordinates the PHP process lifecycle and message proxying
+// Proxy coordinates the PHP worker pool lifecycle and message proxying
 type Proxy struct {
-	process        *PHPProcess
-	buffer         *MessageBuffer
-	restarting     bool
-	workingDir     string
-	phpBinary      string
-	restartInterval time.Duration
+	workers          []*worker
+	workingDir       string
+	phpBinary        string
+	restartInterval  time.Duration
+	replayStaleAfter time.Duration
+	drainTimeout     time.Duration
+	redactTail       bool
+
+	stdoutMu sync.Mutex
+
+	rotateMu   sync.Mutex
+	rotateNext int // index of the next worker due for a rolling restart
+
+	nextRouteMu sync.Mutex
+	nextRoute   int // round-robin cursor for notifications, which have no id to hash
+
+	failCh chan error // receives a worker's terminal crash-loop error
+
+	metrics *metrics
+
+	tailIn  *tailBuffer
+	tailOut *tailBuffer
+
+	pingMu      sync.Mutex
+	pingWaiters map[string]chan struct{}
 }
 
-// NewProxy creates a new Proxy instance
-func NewProxy(workingDir, phpBinary string, restartInterval time.Duration, bufferSize int) *Proxy {
+// NewProxy creates a new Proxy instance with a pool of numWorkers PHP workers
+func NewProxy(workingDir, phpBinary string, restartInterval time.Duration, bufferSize, numWorkers int, replayStaleAfter time.Duration, stderrFormat stderrlog.Format, crashLoopMaxFailures int, crashLoopWindow, drainTimeout time.Duration, tailSize int, redactTail bool) *Proxy {
+	workers := make([]*worker, numWorkers)
+	for i := range workers {
+		workers[i] = newWorker(i, bufferSize, replayStaleAfter, stderrFormat, crashLoopMaxFailures, crashLoopWindow)
+	}
+
 	return &Proxy{
-		process:         NewPHPProcess(),
-		buffer:          NewMessageBuffer(bufferSize),
-		workingDir:      workingDir,
-		phpBinary:       phpBinary,
-		restartInterval: restartInterval,
+		workers:          workers,
+		workingDir:       workingDir,
+		phpBinary:        phpBinary,
+		restartInterval:  restartInterval,
+		replayStaleAfter: replayStaleAfter,
+		drainTimeout:     drainTimeout,
+		redactTail:       redactTail,
+		failCh:           make(chan error, numWorkers),
+		metrics:          newMetrics(),
+		tailIn:           newTailBuffer(tailSize),
+		tailOut:          newTailBuffer(tailSize),
+		pingWaiters:      make(map[string]chan struct{}),
 	}
 }
 
-// Run starts the proxy and manages the PHP process lifecycle
+// Run starts the proxy and manages the PHP worker pool lifecycle. It returns
+// a terminal error if a worker's crash-loop breaker trips.
 func (p *Proxy) Run(ctx context.Context) error {
-	// Start initial PHP process
-	if err := p.startPHP(); err != nil {
-		return fmt.Errorf("failed to start PHP process: %w", err)
+	// runCtx is canceled both on the caller's ctx and on a terminal worker
+	// failure, so every goroutine below stops in either case.
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	for i, w := range p.workers {
+		w.mu.Lock()
+		err := w.start(p.workingDir, p.phpBinary)
+		w.mu.Unlock()
+		if err != nil {
+			cancel()
+			for _, started := range p.workers[:i] {
+				started.mu.Lock()
+				started.stop()
+				started.mu.Unlock()
+			}
+			return fmt.Errorf("failed to start worker %d: %w", w.index, err)
+		}
+		go p.monitorWorker(runCtx, w)
+		go p.proxyWorkerStdout(runCtx, w, w.currentProcess())
 	}
 
-	// Setup restart timer
+	// Setup rolling restart timer. Each tick rotates a single worker through
+	// a blue/green restart while the others keep serving traffic.
 	ticker := time.NewTicker(p.restartInterval)
 	defer ticker.Stop()
 
-	// Monitor PHP process for unexpected exits
-	go p.monitorProcess(ctx)
-
-	// Start proxying stdio
-	go p.proxyStdio(ctx)
+	go p.proxyStdin(runCtx)
 
-	// Main loop
 	for {
 		select {
 		case <-ticker.C:
-			log.Printf("Restart timer triggered")
-			if err := p.restartPHP(); err != nil {
-				log.Printf("Failed to restart PHP: %v", err)
+			w := p.nextRotationWorker()
+			log.Printf("Restart timer triggered for worker %d", w.index)
+			if err := p.restartWorker(w); err != nil {
+				log.Printf("Failed to restart worker %d: %v", w.index, err)
 			}
+		case err := <-p.failCh:
+			log.Printf("Worker crash-loop detected, shutting down: %v", err)
+			cancel()
+			for _, w := range p.workers {
+				w.mu.Lock()
+				w.stop()
+				w.mu.Unlock()
+			}
+			return err
 		case <-ctx.Done():
 			log.Printf("Shutting down proxy")
-			p.stopPHP()
+			for _, w := range p.workers {
+				w.mu.Lock()
+				w.stop()
+				w.mu.Unlock()
+			}
 			return nil
 		}
 	}
 }
 
-// startPHP starts a new PHP process
-func (p *Proxy) startPHP() error {
-	log.Printf("Starting PHP process")
-	return p.process.Start(p.workingDir, p.phpBinary)
+// fail reports a terminal worker failure to Run, which shuts down the pool
+// and returns err. Only the first reported failure is delivered.
+func (p *Proxy) fail(err error) {
+	select {
+	case p.failCh <- err:
+	default:
+	}
 }
 
-// stopPHP stops the current PHP process
-func (p *Proxy) stopPHP() error {
-	return p.process.Stop()
+// nextRotationWorker returns the next worker due for a rolling restart and
+// advances the rotation cursor.
+func (p *Proxy) nextRotationWorker() *worker {
+	p.rotateMu.Lock()
+	defer p.rotateMu.Unlock()
+	w := p.workers[p.rotateNext]
+	p.rotateNext = (p.rotateNext + 1) % len(p.workers)
+	return w
 }
 
-// restartPHP performs a restart of the PHP process
-func (p *Proxy) restartPHP() error {
-	p.restarting = true
-	defer func() { p.restarting = false }()
+// restartWorker performs a blue/green restart of a single worker. It stops
+// routing new requests to the worker, then waits up to drainTimeout for
+// requests already in flight to receive their response on the worker's
+// still-open stdout before terminating it. Only requests still outstanding
+// once the drain expires are replayed (or failed) against the replacement
+// process; other workers continue serving traffic throughout.
+func (p *Proxy) restartWorker(w *worker) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.restarting.Store(true)
+	defer w.restarting.Store(false)
 
-	log.Printf("Buffering messages during restart")
+	log.Printf("Draining worker %d before restart (timeout %s)", w.index, p.drainTimeout)
+	p.waitForDrain(w)
 
-	// Stop old process
-	if err := p.stopPHP(); err != nil {
-		log.Printf("Error stopping PHP: %v", err)
+	if err := w.stop(); err != nil {
+		log.Printf("Error stopping worker %d: %v", w.index, err)
 	}
+	p.metrics.restarts.Add(1)
 
-	// Create new process instance
-	p.process = NewPHPProcess()
+	replay, stale := w.buffer.Drain()
+	p.synthesizeErrors(w, stale, "stale")
 
-	// Start new process
-	if err := p.startPHP(); err != nil {
-		return fmt.Errorf("failed to start new PHP process: %w", err)
+	w.replace()
+
+	if err := w.start(p.workingDir, p.phpBinary); err != nil {
+		p.synthesizeErrors(w, replay, "unreplayable")
+		return fmt.Errorf("failed to restart worker %d: %w", w.index, err)
 	}
+	proc := w.process
+	go p.proxyWorkerStdout(context.Background(), w, proc)
 
-	// Replay buffered messages
-	bufferLen := p.buffer.Len()
-	if bufferLen > 0 {
-		log.Printf("Replaying %d buffered messages", bufferLen)
-		if err := p.buffer.Replay(p.process.Stdin()); err != nil {
-			return fmt.Errorf("failed to replay messages: %w", err)
-		}
+	return p.replayRequests(w, proc, replay)
+}
+
+// synthesizeErrors synthesizes a restart error response for each request in
+// reqs, logging reason (e.g. "stale", "unreplayable") for why they were
+// abandoned rather than replayed.
+func (p *Proxy) synthesizeErrors(w *worker, reqs []*pendingRequest, reason string) {
+	for _, req := range reqs {
+		log.Printf("Dropping %s request %s on worker %d, synthesizing restart error", reason, req.id, w.index)
+		p.metrics.drops.Add(1)
+		p.writeStdout(synthesizeRestartError(req.id))
 	}
+}
 
+// replayRequests re-sends reqs to proc, w's (already restarted) process, and
+// re-tracks them as outstanding, synthesizing a restart error for any that
+// get evicted again before they can be answered. proc is passed explicitly
+// rather than read from w.process because replayRequests can run after w.mu
+// is released (from monitorWorker), by which point a concurrent restart
+// could have replaced w.process again.
+func (p *Proxy) replayRequests(w *worker, proc *PHPProcess, reqs []*pendingRequest) error {
+	if len(reqs) == 0 {
+		return nil
+	}
+
+	log.Printf("Replaying %d outstanding requests on worker %d", len(reqs), w.index)
+	for _, req := range reqs {
+		if _, err := proc.Stdin().Write(req.raw); err != nil {
+			return fmt.Errorf("failed to replay messages on worker %d: %w", w.index, err)
+		}
+		if evicted := w.buffer.Track(&rpcMessage{raw: req.raw, id: req.id}); evicted != nil {
+			p.synthesizeErrors(w, []*pendingRequest{evicted}, "evicted")
+		}
+	}
 	return nil
 }
 
-// proxyStdio handles bidirectional stdio proxying
-func (p *Proxy) proxyStdio(ctx context.Context) {
-	// Proxy stdin from client to PHP
-	go p.proxyStdin(ctx)
+// waitForDrain blocks until w has no outstanding requests or drainTimeout
+// elapses, whichever comes first. The worker's stdout reader keeps running
+// throughout, so responses that arrive during the wait are still delivered
+// to the client and resolved out of the buffer.
+func (p *Proxy) waitForDrain(w *worker) {
+	deadline := time.Now().Add(p.drainTimeout)
+	for w.buffer.Len() > 0 && time.Now().Before(deadline) {
+		time.Sleep(25 * time.Millisecond)
+	}
+	if remaining := w.buffer.Len(); remaining > 0 {
+		log.Printf("Drain timeout elapsed for worker %d with %d requests still outstanding", w.index, remaining)
+	}
+}
 
-	// Proxy stdout from PHP to client
-	go p.proxyStdout(ctx)
+// routeWorker picks the worker a message should be sent to: messages with an
+// id are hashed so retries of the same id always land on the same worker;
+// notifications are spread round-robin.
+func (p *Proxy) routeWorker(msg *rpcMessage) *worker {
+	if msg.isNotification() {
+		p.nextRouteMu.Lock()
+		idx := p.nextRoute % len(p.workers)
+		p.nextRoute++
+		p.nextRouteMu.Unlock()
+		return p.workers[idx]
+	}
+
+	h := fnv.New32a()
+	h.Write(msg.id)
+	return p.workers[h.Sum32()%uint32(len(p.workers))]
 }
 
-// proxyStdin proxies stdin from the client to the PHP process
+// proxyStdin proxies stdin from the client, routing each decoded message to
+// the worker responsible for its id
 func (p *Proxy) proxyStdin(ctx context.Context) {
-	reader := bufio.NewReader(os.Stdin)
-	buf := make([]byte, 4096)
+	decoder := NewMessageDecoder(os.Stdin)
 
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		default:
-			n, err := reader.Read(buf)
-			if n > 0 {
-				message := buf[:n]
-
-				if p.restarting {
-					// Buffer messages during restart
-					p.buffer.Add(message)
-				} else {
-					// Send directly to PHP process
-					if _, err := p.process.Stdin().Write(message); err != nil {
-						log.Printf("Error writing to PHP stdin: %v", err)
-						return
-					}
-				}
-			}
+			msg, err := decoder.Next()
 			if err != nil {
 				if err != io.EOF {
 					log.Printf("Error reading from stdin: %v", err)
 				}
 				return
 			}
+
+			p.metrics.messagesIn.Add(1)
+			p.recordTail(p.tailIn, msg.raw)
+
+			w := p.routeWorker(msg)
+			if evicted := w.buffer.Track(msg); evicted != nil {
+				log.Printf("Buffer full for worker %d, dropping oldest outstanding request %s", w.index, evicted.id)
+				p.metrics.drops.Add(1)
+				p.writeStdout(synthesizeRestartError(evicted.id))
+			}
+
+			if w.restarting.Load() {
+				// New PHP process isn't ready yet; leave the request tracked
+				// as outstanding so restartWorker replays or fails it.
+				continue
+			}
+
+			if _, err := w.currentProcess().Stdin().Write(msg.raw); err != nil {
+				log.Printf("Error writing to worker %d stdin: %v", w.index, err)
+			}
 		}
 	}
 }
 
-// proxyStdout proxies stdout from the PHP process to the client
-func (p *Proxy) proxyStdout(ctx context.Context) {
-	buf := make([]byte, 4096)
+// proxyWorkerStdout proxies stdout from a single worker's PHP process to the
+// client, resolving tracked requests as their responses arrive. It exits when
+// the worker's process pipe is closed (including across a restart, since
+// restartWorker starts a fresh copy of this goroutine against the new pipe).
+// proc is passed explicitly (rather than read from w.process) so this
+// goroutine stays bound to the process it was spawned for even if a
+// concurrent restart replaces w.process before it starts reading.
+func (p *Proxy) proxyWorkerStdout(ctx context.Context, w *worker, proc *PHPProcess) {
+	decoder := NewMessageDecoder(proc.Stdout())
 
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		default:
-			n, err := p.process.Stdout().Read(buf)
-			if n > 0 {
-				if _, err := os.Stdout.Write(buf[:n]); err != nil {
-					log.Printf("Error writing to stdout: %v", err)
-					return
-				}
-			}
+			msg, err := decoder.Next()
 			if err != nil {
 				if err != io.EOF {
-					log.Printf("Error reading from PHP stdout: %v", err)
+					log.Printf("Error reading from worker %d stdout: %v", w.index, err)
 				}
 				return
 			}
+
+			if !msg.isNotification() {
+				if queuedAt, ok := w.buffer.Resolve(msg.id); ok {
+					p.metrics.observeLatency(time.Since(queuedAt))
+				}
+				p.notifyPingWaiter(msg.idKey())
+			}
+
+			p.metrics.messagesOut.Add(1)
+			p.recordTail(p.tailOut, msg.raw)
+			p.writeStdout(msg.raw)
 		}
 	}
 }
 
-// monitorProcess watches for unexpected PHP process exits
-func (p *Proxy) monitorProcess(ctx context.Context) {
+// writeStdout serializes writes to the client's stdout across workers
+func (p *Proxy) writeStdout(b []byte) {
+	p.stdoutMu.Lock()
+	defer p.stdoutMu.Unlock()
+	if _, err := os.Stdout.Write(b); err != nil {
+		log.Printf("Error writing to stdout: %v", err)
+	}
+}
+
+// monitorWorker watches for unexpected exits of a single worker's PHP
+// process, restarting it with exponential backoff and tripping the worker's
+// crash-loop breaker if it keeps failing.
+func (p *Proxy) monitorWorker(ctx context.Context, w *worker) {
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		default:
-			err := p.process.Wait()
-			if err != nil && !p.restarting {
-				log.Printf("PHP process died unexpectedly: %v", err)
-				log.Printf("Attempting immediate restart")
+		}
 
-				// Create new process instance
-				p.process = NewPHPProcess()
+		startedAt := time.Now()
+		err := w.currentProcess().Wait()
 
-				if err := p.startPHP(); err != nil {
-					log.Printf("Failed to restart PHP: %v", err)
-					time.Sleep(time.Second) // Backoff before retry
-				}
+		if ctx.Err() != nil {
+			return
+		}
+		if w.restarting.Load() {
+			// restartWorker owns this exit; nothing to supervise here.
+			continue
+		}
+
+		log.Printf("Worker %d PHP process died unexpectedly: %v", w.index, err)
+		p.metrics.crashes.Add(1)
+
+		if time.Since(startedAt) >= healthyAfter {
+			w.breaker.recordHealthy()
+		}
+
+		// Hold w.mu for the whole crash-recovery attempt, the same lock
+		// restartWorker takes, so a scheduled restart can't race this
+		// retry loop's stop/replace/start calls on the same worker.
+		w.mu.Lock()
+		replay, stale := w.buffer.Drain()
+		p.synthesizeErrors(w, stale, "stale")
+
+		var proc *PHPProcess
+		giveUp := false
+		for {
+			if w.breaker.recordFailure(time.Now()) {
+				p.synthesizeErrors(w, replay, "unrecoverable")
+				p.fail(fmt.Errorf("worker %d crash-looped: %d failures within %s", w.index, w.breaker.maxFailures, w.breaker.window))
+				giveUp = true
+				break
+			}
+
+			backoff := w.breaker.nextBackoff()
+			log.Printf("Restarting worker %d in %s", w.index, backoff)
+			select {
+			case <-ctx.Done():
+				w.mu.Unlock()
+				return
+			case <-time.After(backoff):
+			}
+
+			w.replace()
+			if err := w.start(p.workingDir, p.phpBinary); err != nil {
+				log.Printf("Failed to restart worker %d: %v", w.index, err)
+				continue
 			}
+			proc = w.process
+			p.metrics.restarts.Add(1)
+			break
+		}
+		w.mu.Unlock()
+
+		if giveUp {
+			return
+		}
+
+		go p.proxyWorkerStdout(ctx, w, proc)
+
+		if err := p.replayRequests(w, proc, replay); err != nil {
+			log.Printf("Failed to replay outstanding requests on worker %d: %v", w.index, err)
 		}
 	}
 }
@@ -0,0 +1,65 @@
+package proxy
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// TailEntry is a single recorded message, exposed to the admin server's
+// /debug/tail endpoint.
+type TailEntry struct {
+	Timestamp time.Time
+	Data      string
+}
+
+// tailBuffer keeps the last N messages seen in one direction.
+type tailBuffer struct {
+	mu      sync.Mutex
+	entries []TailEntry
+	max     int
+}
+
+func newTailBuffer(max int) *tailBuffer {
+	return &tailBuffer{max: max}
+}
+
+func (t *tailBuffer) add(data string) {
+	if t.max <= 0 {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.entries = append(t.entries, TailEntry{Timestamp: time.Now(), Data: data})
+	if len(t.entries) > t.max {
+		t.entries = t.entries[len(t.entries)-t.max:]
+	}
+}
+
+func (t *tailBuffer) snapshot() []TailEntry {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	out := make([]TailEntry, len(t.entries))
+	copy(out, t.entries)
+	return out
+}
+
+// TailSnapshot returns the last messages seen in each direction, for the
+// admin server's /debug/tail endpoint. Bodies are redacted if the proxy was
+// configured with tail redaction enabled.
+func (p *Proxy) TailSnapshot() (in, out []TailEntry) {
+	return p.tailIn.snapshot(), p.tailOut.snapshot()
+}
+
+// recordTail appends raw to buf, redacting the body down to its length if
+// the proxy has tail redaction enabled.
+func (p *Proxy) recordTail(buf *tailBuffer, raw []byte) {
+	if p.redactTail {
+		buf.add(fmt.Sprintf("[redacted %d bytes]", len(raw)))
+		return
+	}
+	buf.add(string(raw))
+}
@@ -0,0 +1,70 @@
+package proxy
+
+import (
+	"log"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/wachterjohannes/debug-mcp-go-wrapper/internal/stderrlog"
+)
+
+// worker owns a single PHP process and its outstanding-request buffer. The
+// pool routes requests to workers by hashing their JSON-RPC id so retries of
+// the same id always land on the same worker.
+type worker struct {
+	index int
+
+	// mu serializes restartWorker's scheduled restart against
+	// monitorWorker's crash-recovery restart, so only one of them ever
+	// stops/replaces/starts this worker's process at a time. Callers must
+	// hold mu while touching process, including start/stop/replace below.
+	mu           sync.Mutex
+	process      *PHPProcess
+	buffer       *MessageBuffer
+	breaker      *crashLoopBreaker
+	restarting   atomic.Bool
+	bufferSize   int
+	staleAfter   time.Duration
+	stderrFormat stderrlog.Format
+}
+
+// newWorker creates a worker in its not-yet-started state.
+func newWorker(index, bufferSize int, replayStaleAfter time.Duration, stderrFormat stderrlog.Format, crashLoopMaxFailures int, crashLoopWindow time.Duration) *worker {
+	return &worker{
+		index:        index,
+		process:      NewPHPProcess(stderrFormat, strconv.Itoa(index)),
+		buffer:       NewMessageBuffer(bufferSize, replayStaleAfter),
+		breaker:      newCrashLoopBreaker(crashLoopMaxFailures, crashLoopWindow),
+		bufferSize:   bufferSize,
+		staleAfter:   replayStaleAfter,
+		stderrFormat: stderrFormat,
+	}
+}
+
+// start launches the worker's PHP process. Callers must hold w.mu.
+func (w *worker) start(workingDir, phpBinary string) error {
+	log.Printf("Starting PHP process for worker %d", w.index)
+	return w.process.Start(workingDir, phpBinary)
+}
+
+// stop terminates the worker's PHP process. Callers must hold w.mu.
+func (w *worker) stop() error {
+	return w.process.Stop()
+}
+
+// replace swaps in a fresh, not-yet-started PHPProcess for this worker, used
+// after a restart or an unexpected exit. Callers must hold w.mu.
+func (w *worker) replace() {
+	w.process = NewPHPProcess(w.stderrFormat, strconv.Itoa(w.index))
+}
+
+// currentProcess returns the worker's current process, for callers that only
+// need a one-off read (e.g. writing to stdin) and don't hold w.mu across the
+// restart-handling critical section.
+func (w *worker) currentProcess() *PHPProcess {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.process
+}
@@ -0,0 +1,151 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/wachterjohannes/debug-mcp-go-wrapper/internal/stderrlog"
+)
+
+// crashOnceThenEchoScript stands in for a PHP debug-mcp worker: its first
+// invocation exits immediately without reading stdin, simulating an
+// unexpected crash; every invocation after that reads one JSON-RPC request
+// line and echoes back a result carrying the same id.
+const crashOnceThenEchoScript = `#!/bin/sh
+marker="$(dirname "$0")/.crashed-once"
+if [ ! -f "$marker" ]; then
+  touch "$marker"
+  exit 1
+fi
+read -r line
+id=$(echo "$line" | sed -n 's/.*"id":\([0-9]*\).*/\1/p')
+printf '{"jsonrpc":"2.0","id":%s,"result":true}\n' "$id"
+exit 0
+`
+
+// newCrashOnceWorkingDir lays out a bin/debug-mcp script implementing
+// crashOnceThenEchoScript under a fresh temp directory, for use as a
+// PHPProcess's workingDir with "/bin/sh" as its phpBinary.
+func newCrashOnceWorkingDir(t *testing.T) string {
+	t.Helper()
+	if _, err := os.Stat("/bin/sh"); err != nil {
+		t.Skip("/bin/sh not available in this environment")
+	}
+
+	dir := t.TempDir()
+	binDir := filepath.Join(dir, "bin")
+	if err := os.MkdirAll(binDir, 0o755); err != nil {
+		t.Fatalf("MkdirAll: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(binDir, "debug-mcp"), []byte(crashOnceThenEchoScript), 0o755); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	return dir
+}
+
+// captureStdout redirects the package-level os.Stdout (what writeStdout
+// writes to) to an in-memory pipe. peek returns everything captured so far
+// without stopping capture; restore stops capture and returns the final
+// contents.
+func captureStdout(t *testing.T) (peek func() string, restore func() string) {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("os.Pipe: %v", err)
+	}
+
+	orig := os.Stdout
+	os.Stdout = w
+
+	var mu sync.Mutex
+	var buf strings.Builder
+	done := make(chan struct{})
+	go func() {
+		chunk := make([]byte, 4096)
+		for {
+			n, err := r.Read(chunk)
+			mu.Lock()
+			buf.Write(chunk[:n])
+			mu.Unlock()
+			if err != nil {
+				break
+			}
+		}
+		close(done)
+	}()
+
+	peek = func() string {
+		mu.Lock()
+		defer mu.Unlock()
+		return buf.String()
+	}
+	restore = func() string {
+		os.Stdout = orig
+		w.Close()
+		<-done
+		return peek()
+	}
+	return peek, restore
+}
+
+// TestMonitorWorkerReplaysOutstandingRequestOnCrash drives a worker through
+// an unexpected process exit and asserts that a request which was still
+// outstanding at the time of the crash is replayed against the replacement
+// process and its response reaches the client, instead of being silently
+// dropped.
+func TestMonitorWorkerReplaysOutstandingRequestOnCrash(t *testing.T) {
+	workingDir := newCrashOnceWorkingDir(t)
+
+	w := newWorker(0, 10, time.Minute, stderrlog.FormatRaw, 10, time.Minute)
+	if err := w.start(workingDir, "/bin/sh"); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	defer w.stop()
+
+	p := &Proxy{
+		workingDir: workingDir,
+		phpBinary:  "/bin/sh",
+		metrics:    newMetrics(),
+		tailIn:     newTailBuffer(10),
+		tailOut:    newTailBuffer(10),
+	}
+
+	// This request was sent to the worker's first (about-to-crash) process
+	// and never got a response before it exited.
+	w.buffer.Track(&rpcMessage{raw: []byte(`{"jsonrpc":"2.0","id":1,"method":"ping"}` + "\n"), id: json.RawMessage("1")})
+
+	peekStdout, restore := captureStdout(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	monitorDone := make(chan struct{})
+	go func() {
+		p.monitorWorker(ctx, w)
+		close(monitorDone)
+	}()
+
+	// Give monitorWorker time to notice the crash, back off, restart, and
+	// replay the outstanding request against the replacement process.
+	deadline := time.Now().Add(5 * time.Second)
+	var out string
+	for {
+		time.Sleep(50 * time.Millisecond)
+		out = peekStdout()
+		if strings.Contains(out, `"id":1`) || time.Now().After(deadline) {
+			break
+		}
+	}
+
+	cancel()
+	<-monitorDone
+	out += restore()
+
+	if !strings.Contains(out, `"id":1`) {
+		t.Fatalf("expected the replayed request's response to reach the client, got %q", out)
+	}
+}
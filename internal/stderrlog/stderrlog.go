@@ -0,0 +1,137 @@
+// Package stderrlog scans a PHP process's stderr, opportunistically decoding
+// structured JSON log lines and re-emitting them through log/slog, while
+// falling back to logging the raw line for anything that isn't JSON.
+package stderrlog
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// Format selects how stderr lines are interpreted.
+type Format string
+
+const (
+	// FormatAuto attempts to decode each line as a JSON record, falling back
+	// to logging it raw when decoding fails.
+	FormatAuto Format = "auto"
+	// FormatJSON behaves like FormatAuto but is explicit about the PHP
+	// process being expected to emit structured logs.
+	FormatJSON Format = "json"
+	// FormatRaw never attempts JSON decoding and logs every line as-is.
+	FormatRaw Format = "raw"
+)
+
+// ParseFormat validates a --stderr-format flag value.
+func ParseFormat(s string) (Format, error) {
+	switch Format(s) {
+	case FormatAuto, FormatJSON, FormatRaw:
+		return Format(s), nil
+	default:
+		return "", fmt.Errorf("invalid stderr format %q (want auto, json, or raw)", s)
+	}
+}
+
+// record is the structured shape a PHP process is expected to log in
+// json/auto mode.
+type record struct {
+	Level     string          `json:"level"`
+	Message   string          `json:"message"`
+	Timestamp string          `json:"timestamp"`
+	Context   json.RawMessage `json:"context"`
+}
+
+// Scanner reads lines from a PHP process's stderr, reassembling lines split
+// across Read boundaries, and logs each one through logger.
+type Scanner struct {
+	r      *bufio.Reader
+	format Format
+	logger *slog.Logger
+	source string
+}
+
+// NewScanner creates a Scanner over r. source identifies which PHP process
+// the lines came from (e.g. a worker index) and is attached to every
+// log entry.
+func NewScanner(r io.Reader, format Format, logger *slog.Logger, source string) *Scanner {
+	return &Scanner{
+		r:      bufio.NewReaderSize(r, 64*1024),
+		format: format,
+		logger: logger,
+		source: source,
+	}
+}
+
+// Run reads and logs lines until r is exhausted or returns an error.
+func (s *Scanner) Run() {
+	for {
+		line, err := s.r.ReadString('\n')
+		if len(line) > 0 {
+			s.emit(strings.TrimRight(line, "\r\n"))
+		}
+		if err != nil {
+			if err != io.EOF {
+				s.logger.Error("error reading PHP stderr", "worker", s.source, "error", err)
+			}
+			return
+		}
+	}
+}
+
+// emit logs a single stderr line, decoding it as JSON unless format is raw.
+func (s *Scanner) emit(line string) {
+	if line == "" {
+		return
+	}
+
+	if s.format != FormatRaw {
+		if rec, ok := parseRecord(line); ok {
+			attrs := []any{"worker", s.source}
+			if rec.Timestamp != "" {
+				attrs = append(attrs, "timestamp", rec.Timestamp)
+			}
+			if len(rec.Context) > 0 {
+				attrs = append(attrs, "context", string(rec.Context))
+			}
+			s.logger.Log(context.Background(), levelFor(rec.Level), rec.Message, attrs...)
+			return
+		}
+	}
+
+	s.logger.Info(line, "worker", s.source, "raw", true)
+}
+
+// parseRecord decodes line as a JSON log record, returning ok=false for
+// anything that isn't a well-formed record with a message.
+func parseRecord(line string) (record, bool) {
+	trimmed := strings.TrimSpace(line)
+	if !strings.HasPrefix(trimmed, "{") {
+		return record{}, false
+	}
+
+	var rec record
+	if err := json.Unmarshal([]byte(trimmed), &rec); err != nil || rec.Message == "" {
+		return record{}, false
+	}
+	return rec, true
+}
+
+// levelFor maps a record's level string onto a slog.Level, defaulting to Info
+// for anything unrecognized.
+func levelFor(level string) slog.Level {
+	switch strings.ToLower(level) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn", "warning":
+		return slog.LevelWarn
+	case "error", "critical", "fatal":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}